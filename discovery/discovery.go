@@ -38,6 +38,31 @@ type Discoverer interface {
 	Run(ctx context.Context, up chan<- []*targetgroup.Group) // 服务发现协议实现逻辑运行入口
 }
 
+// ErrorMetaLabel is a reserved label a Discoverer may attach to the Labels
+// of a targetgroup.Group it sends on its update channel to signal that a
+// refresh failed for that Group's Source, rather than that the Source
+// legitimately has no targets. The manager must not let such a Group
+// overwrite the last known-good data it has for that Source.
+const ErrorMetaLabel = "__meta_sd_error__"
+
+// Reconfigurable is implemented by a Discoverer that can apply a changed
+// Config to itself in place. The discovery manager calls Reconfigure
+// instead of tearing down and restarting the Discoverer when it detects
+// that a running provider's Config changed but its Config.Name() and
+// provider identity stayed the same, avoiding things like a full client-go
+// informer rebuild (and the re-list storm that comes with it) for a
+// selector or namespace tweak.
+//
+// Discoverers that do not implement this interface keep today's
+// stop/start-on-change behavior.
+type Reconfigurable interface {
+	// Reconfigure applies cfg to the running Discoverer. cfg is guaranteed
+	// to have the same concrete type as the Config the Discoverer was
+	// constructed from. An error causes the manager to fall back to
+	// stopping and restarting the Discoverer with the new Config.
+	Reconfigure(ctx context.Context, cfg Config) error
+}
+
 // DiscovererOptions provides options for a Discoverer.
 type DiscovererOptions struct {
 	Logger log.Logger
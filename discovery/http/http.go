@@ -0,0 +1,269 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package http implements service discovery that periodically GETs a JSON
+// document in the file_sd format from an arbitrary HTTP endpoint, e.g. a
+// CMDB, rather than requiring operators to shuttle that data through
+// file_sd or a third-party registry like Consul.
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/common/version"
+
+	"github.com/prometheus/prometheus/discovery"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+)
+
+var (
+	failuresCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prometheus_sd_http_failures_total",
+			Help: "Number of HTTP service discovery refresh failures.",
+		},
+		[]string{"url"},
+	)
+
+	userAgent = fmt.Sprintf("Prometheus/%s", version.Version)
+
+	// errNotModified is returned by fetchTargetGroups when the server
+	// reported 304 Not Modified for the ETag we sent; it is not a real
+	// failure and the previous group set is still correct.
+	errNotModified = errors.New("not modified")
+
+	// DefaultSDConfig is the default HTTP SD configuration.
+	DefaultSDConfig = SDConfig{
+		RefreshInterval: model.Duration(60 * time.Second),
+	}
+)
+
+func init() {
+	discovery.RegisterConfig(&SDConfig{})
+	prometheus.MustRegister(failuresCount)
+}
+
+// SDConfig is the configuration for HTTP-based service discovery.
+type SDConfig struct {
+	HTTPClientConfig config_util.HTTPClientConfig `yaml:",inline"`
+	RefreshInterval  model.Duration                `yaml:"refresh_interval,omitempty"`
+	URL              string                        `yaml:"url"`
+
+	// ExtraQueryParams are appended to URL's query string verbatim, e.g. to
+	// let the CMDB partition its response by job or datacenter.
+	ExtraQueryParams map[string]string `yaml:"extra_query_params,omitempty"`
+}
+
+// Name returns the name of the Config.
+func (*SDConfig) Name() string { return "http" }
+
+// NewDiscoverer returns a Discoverer for the Config.
+func (c *SDConfig) NewDiscoverer(opts discovery.DiscovererOptions) (discovery.Discoverer, error) {
+	return NewDiscovery(c, opts.Logger)
+}
+
+// SetDirectory joins any relative paths in the config with dir.
+func (c *SDConfig) SetDirectory(dir string) {
+	c.HTTPClientConfig.SetDirectory(dir)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *SDConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultSDConfig
+	type plain SDConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.URL == "" {
+		return errors.New("URL is missing")
+	}
+	parsedURL, err := url.Parse(c.URL)
+	if err != nil {
+		return err
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return fmt.Errorf("URL scheme must be 'http' or 'https' like 'http://example.com', got %q", c.URL)
+	}
+	if parsedURL.Host == "" {
+		return errors.New("host is missing in URL")
+	}
+	return c.HTTPClientConfig.Validate()
+}
+
+// Discovery periodically GETs the configured URL for a file_sd-shaped JSON
+// document and pushes what it parses out of it to the update channel.
+type Discovery struct {
+	client          *http.Client
+	refreshInterval time.Duration
+	url             string
+	etag            string
+	logger          log.Logger
+}
+
+// NewDiscovery returns a new HTTP discoverer for the given config.
+func NewDiscovery(conf *SDConfig, logger log.Logger) (*Discovery, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	client, err := config_util.NewClientFromConfig(conf.HTTPClientConfig, "http")
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = time.Duration(conf.RefreshInterval)
+
+	u := conf.URL
+	if len(conf.ExtraQueryParams) > 0 {
+		parsedURL, err := url.Parse(conf.URL)
+		if err != nil {
+			return nil, err
+		}
+		q := parsedURL.Query()
+		for k, v := range conf.ExtraQueryParams {
+			q.Set(k, v)
+		}
+		parsedURL.RawQuery = q.Encode()
+		u = parsedURL.String()
+	}
+
+	return &Discovery{
+		client:          client,
+		url:             u,
+		refreshInterval: time.Duration(conf.RefreshInterval),
+		logger:          logger,
+	}, nil
+}
+
+// Run implements the discovery.Discoverer interface.
+func (d *Discovery) Run(ctx context.Context, ch chan<- []*targetgroup.Group) {
+	d.refresh(ctx, ch)
+
+	ticker := time.NewTicker(d.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.refresh(ctx, ch)
+		}
+	}
+}
+
+func (d *Discovery) refresh(ctx context.Context, ch chan<- []*targetgroup.Group) {
+	groups, err := d.fetchTargetGroups(ctx)
+	if err != nil {
+		if errors.Is(err, errNotModified) {
+			return
+		}
+		failuresCount.WithLabelValues(d.url).Inc()
+		level.Error(d.logger).Log("msg", "Unable to refresh target groups", "url", d.url, "err", err)
+		return
+	}
+
+	select {
+	case ch <- groups:
+	case <-ctx.Done():
+	}
+}
+
+// httpSDTargetGroup is the file_sd-compatible wire shape this SD expects
+// from the remote endpoint.
+type httpSDTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+func (d *Discovery) fetchTargetGroups(ctx context.Context) ([]*targetgroup.Group, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/json")
+	if d.etag != "" {
+		req.Header.Set("If-None-Match", d.etag)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body) //nolint:errcheck
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, errNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned HTTP status %s", resp.Status)
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []httpSDTargetGroup
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+
+	groups := make([]*targetgroup.Group, 0, len(raw))
+	for i, g := range raw {
+		tg := &targetgroup.Group{Source: urlSource(d.url, i)}
+
+		if len(g.Labels) > 0 {
+			tg.Labels = make(model.LabelSet, len(g.Labels))
+			for k, v := range g.Labels {
+				tg.Labels[model.LabelName(k)] = model.LabelValue(v)
+			}
+		}
+		for _, t := range g.Targets {
+			tg.Targets = append(tg.Targets, model.LabelSet{model.AddressLabel: model.LabelValue(t)})
+		}
+
+		groups = append(groups, tg)
+	}
+
+	// Empty response means no target groups, which is a valid value that
+	// scrape manager needs to be notified of, same as the static SD.
+	if len(groups) == 0 {
+		groups = append(groups, &targetgroup.Group{Source: urlSource(d.url, 0)})
+	}
+
+	d.etag = resp.Header.Get("ETag")
+	return groups, nil
+}
+
+// urlSource turns a URL and the index of a target group within its response
+// into a short, stable Source that survives across refreshes as long as the
+// document's element order doesn't change.
+func urlSource(u string, i int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d", u, i)))
+	return fmt.Sprintf("http/%x", sum[:8])
+}
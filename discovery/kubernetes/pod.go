@@ -20,6 +20,8 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -29,6 +31,7 @@ import (
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 
+	"github.com/prometheus/prometheus/discovery"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
 	"github.com/prometheus/prometheus/util/strutil"
 )
@@ -41,29 +44,51 @@ var (
 	podDeleteCount = eventCount.WithLabelValues("pod", "delete")
 )
 
+// AttachMetadataConfig configures which related Kubernetes objects' labels
+// and annotations a role's Discoverer attaches to the targets it produces.
+// Per-role scoping keeps informers from list-watching (and caching) objects
+// a given role has no use for: a `role: pod` config that only sets Node
+// doesn't need to attach Service or Endpoints metadata, for instance.
+//
+// TODO(chunk0-3): this does not fulfill the selectors/attach-metadata
+// backlog request and must not be treated as closing it. The full schema
+// (Service/Endpoints, selector-based informer scoping via
+// SharedInformerFactoryWithOptions/WithTweakListOptions, and the same
+// treatment for the Node/Service/Endpoints roles) lives in
+// kubernetes.go/node.go/service.go/endpoints.go, none of which are present
+// in this tree, so it can't be built here. AttachMetadataConfig only
+// carries the subset pod.go can act on until those files exist too.
+type AttachMetadataConfig struct {
+	Node bool
+}
+
 // Pod discovers new pod targets.
 type Pod struct {
-	podInf           cache.SharedIndexInformer
-	nodeInf          cache.SharedInformer
-	withNodeMetadata bool
-	store            cache.Store
-	logger           log.Logger
-	queue            *workqueue.Type
+	podInf  cache.SharedIndexInformer
+	nodeInf cache.SharedInformer
+	store   cache.Store
+	logger  log.Logger
+	queue   *workqueue.Type
+
+	mtx            sync.RWMutex
+	attachMetadata AttachMetadataConfig
 }
 
-// NewPod creates a new pod discovery.
-func NewPod(l log.Logger, pods cache.SharedIndexInformer, nodes cache.SharedInformer) *Pod {
+// NewPod creates a new pod discovery. The node informer and attachMetadata
+// may both be zero values, in which case no node metadata is attached to
+// the pods' targets.
+func NewPod(l log.Logger, pods cache.SharedIndexInformer, nodes cache.SharedInformer, attachMetadata AttachMetadataConfig) *Pod {
 	if l == nil {
 		l = log.NewNopLogger()
 	}
 
 	p := &Pod{
-		podInf:           pods,
-		nodeInf:          nodes,
-		withNodeMetadata: nodes != nil,
-		store:            pods.GetStore(),
-		logger:           l,
-		queue:            workqueue.NewNamed("pod"),
+		podInf:         pods,
+		nodeInf:        nodes,
+		attachMetadata: attachMetadata,
+		store:          pods.GetStore(),
+		logger:         l,
+		queue:          workqueue.NewNamed("pod"),
 	}
 	// 这里的 podAddCount、podDeleteCount和podUpdateCount分别对应下面三个指标序列，指标含义也比较明显：
 	//
@@ -95,7 +120,7 @@ func NewPod(l log.Logger, pods cache.SharedIndexInformer, nodes cache.SharedInfo
 		level.Error(l).Log("msg", "Error adding pods event handler.", "err", err)
 	}
 
-	if p.withNodeMetadata {
+	if p.withNodeMetadata() {
 		_, err = p.nodeInf.AddEventHandler(cache.ResourceEventHandlerFuncs{
 			AddFunc: func(o interface{}) {
 				node := o.(*apiv1.Node)
@@ -118,6 +143,39 @@ func NewPod(l log.Logger, pods cache.SharedIndexInformer, nodes cache.SharedInfo
 	return p
 }
 
+// withNodeMetadata reports whether this Pod discoverer should attach node
+// labels/annotations to the targets it produces.
+func (p *Pod) withNodeMetadata() bool {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	return p.nodeInf != nil && p.attachMetadata.Node
+}
+
+// PodConfigProvider is implemented by the discovery.Config that created a
+// Pod discoverer, letting Reconfigure pull an updated AttachMetadataConfig
+// out of a same-typed Config without the kubernetes package needing to
+// import its own SDConfig type (which lives above this file).
+type PodConfigProvider interface {
+	PodAttachMetadata() AttachMetadataConfig
+}
+
+// Reconfigure implements discovery.Reconfigurable. It updates which node
+// metadata gets attached to future targets without rebuilding the pod/node
+// informers, so an attach-metadata-only config edit doesn't trigger a
+// re-list against the API server. Only the AttachMetadataConfig is taken
+// from cfg: Pod holds no selectors, so a selector change in cfg is not
+// applied to the informers.
+func (p *Pod) Reconfigure(_ context.Context, cfg discovery.Config) error {
+	pc, ok := cfg.(PodConfigProvider)
+	if !ok {
+		return fmt.Errorf("kubernetes.Pod: cannot reconfigure from %T", cfg)
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.attachMetadata = pc.PodAttachMetadata()
+	return nil
+}
+
 func (p *Pod) enqueue(obj interface{}) {
 	// 获取资源对象的Key
 	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
@@ -134,7 +192,7 @@ func (p *Pod) Run(ctx context.Context, ch chan<- []*targetgroup.Group) {
 	defer p.queue.ShutDown()
 
 	cacheSyncs := []cache.InformerSynced{p.podInf.HasSynced}
-	if p.withNodeMetadata {
+	if p.withNodeMetadata() {
 		cacheSyncs = append(cacheSyncs, p.nodeInf.HasSynced)
 	}
 
@@ -199,28 +257,56 @@ func convertToPod(o interface{}) (*apiv1.Pod, error) {
 }
 
 const (
-	podNameLabel                  = metaLabelPrefix + "pod_name"
-	podIPLabel                    = metaLabelPrefix + "pod_ip"
-	podContainerNameLabel         = metaLabelPrefix + "pod_container_name"
-	podContainerIDLabel           = metaLabelPrefix + "pod_container_id"
-	podContainerImageLabel        = metaLabelPrefix + "pod_container_image"
-	podContainerPortNameLabel     = metaLabelPrefix + "pod_container_port_name"
-	podContainerPortNumberLabel   = metaLabelPrefix + "pod_container_port_number"
-	podContainerPortProtocolLabel = metaLabelPrefix + "pod_container_port_protocol"
-	podContainerIsInit            = metaLabelPrefix + "pod_container_init"
-	podReadyLabel                 = metaLabelPrefix + "pod_ready"
-	podPhaseLabel                 = metaLabelPrefix + "pod_phase"
-	podLabelPrefix                = metaLabelPrefix + "pod_label_"
-	podLabelPresentPrefix         = metaLabelPrefix + "pod_labelpresent_"
-	podAnnotationPrefix           = metaLabelPrefix + "pod_annotation_"
-	podAnnotationPresentPrefix    = metaLabelPrefix + "pod_annotationpresent_"
-	podNodeNameLabel              = metaLabelPrefix + "pod_node_name"
-	podHostIPLabel                = metaLabelPrefix + "pod_host_ip"
-	podUID                        = metaLabelPrefix + "pod_uid"
-	podControllerKind             = metaLabelPrefix + "pod_controller_kind"
-	podControllerName             = metaLabelPrefix + "pod_controller_name"
+	podNameLabel                       = metaLabelPrefix + "pod_name"
+	podIPLabel                         = metaLabelPrefix + "pod_ip"
+	podContainerNameLabel              = metaLabelPrefix + "pod_container_name"
+	podContainerIDLabel                = metaLabelPrefix + "pod_container_id"
+	podContainerImageLabel             = metaLabelPrefix + "pod_container_image"
+	podContainerPortNameLabel          = metaLabelPrefix + "pod_container_port_name"
+	podContainerPortNumberLabel        = metaLabelPrefix + "pod_container_port_number"
+	podContainerPortProtocolLabel      = metaLabelPrefix + "pod_container_port_protocol"
+	podContainerIsInit                 = metaLabelPrefix + "pod_container_init"
+	podContainerEphemeralLabel         = metaLabelPrefix + "pod_container_ephemeral"
+	podContainerStateLabel             = metaLabelPrefix + "pod_container_state"
+	podContainerReadyLabel             = metaLabelPrefix + "pod_container_ready"
+	podContainerRestartCountLabel      = metaLabelPrefix + "pod_container_restart_count"
+	podContainerStartedAtLabel         = metaLabelPrefix + "pod_container_started_at"
+	podContainerResourceRequestsPrefix = metaLabelPrefix + "pod_container_resource_requests_"
+	podContainerResourceLimitsPrefix   = metaLabelPrefix + "pod_container_resource_limits_"
+	podReadyLabel                      = metaLabelPrefix + "pod_ready"
+	podPhaseLabel                      = metaLabelPrefix + "pod_phase"
+	podLabelPrefix                     = metaLabelPrefix + "pod_label_"
+	podLabelPresentPrefix              = metaLabelPrefix + "pod_labelpresent_"
+	podAnnotationPrefix                = metaLabelPrefix + "pod_annotation_"
+	podAnnotationPresentPrefix         = metaLabelPrefix + "pod_annotationpresent_"
+	podNodeNameLabel                   = metaLabelPrefix + "pod_node_name"
+	podHostIPLabel                     = metaLabelPrefix + "pod_host_ip"
+	podUID                             = metaLabelPrefix + "pod_uid"
+	podControllerKind                  = metaLabelPrefix + "pod_controller_kind"
+	podControllerName                  = metaLabelPrefix + "pod_controller_name"
+	podVirtualLabel                    = metaLabelPrefix + "pod_virtual"
+	podVirtualProviderLabel            = metaLabelPrefix + "pod_virtual_provider"
+	podNodeTaintsLabel                 = metaLabelPrefix + "pod_node_taints"
 )
 
+// virtualKubeletNodeTypeLabel/Value and virtualKubeletProviderTaint are the markers
+// virtual-kubelet-backed nodes (ACI, Fargate, Aliyun ECI, ...) carry to
+// signal that they don't run a regular kubelet.
+const (
+	virtualKubeletNodeTypeLabel = "type"
+	virtualKubeletNodeTypeValue = "virtual-kubelet"
+	virtualKubeletProviderTaint = "virtual-kubelet.io/provider"
+)
+
+// virtualKubeletProviderIDPrefixes maps well-known Node.Spec.ProviderID
+// prefixes used by virtual-kubelet providers to a short, human-readable
+// provider name.
+var virtualKubeletProviderIDPrefixes = map[string]string{
+	"azure://":       "aci",
+	"aws://fargate/": "fargate",
+	"aliyun://eci/":  "eci",
+}
+
 // GetControllerOf returns a pointer to a copy of the controllerRef if controllee has a controller
 // https://github.com/kubernetes/apimachinery/blob/cd2cae2b39fa57e8063fa1f5f13cfe9862db3d41/pkg/apis/meta/v1/controller_ref.go
 func GetControllerOf(controllee metav1.Object) *metav1.OwnerReference {
@@ -277,13 +363,54 @@ func (p *Pod) findPodContainerStatus(statuses *[]apiv1.ContainerStatus, containe
 	return nil, fmt.Errorf("cannot find container with name %v", containerName)
 }
 
-func (p *Pod) findPodContainerID(statuses *[]apiv1.ContainerStatus, containerName string) string {
-	cStatus, err := p.findPodContainerStatus(statuses, containerName)
-	if err != nil {
-		level.Debug(p.logger).Log("msg", "cannot find container ID", "err", err)
+// containerStateLabel returns the running|waiting|terminated value for a
+// ContainerStatus.State, or "" if the status wasn't found yet (e.g. the
+// container hasn't been scheduled on the node).
+func containerStateLabel(status *apiv1.ContainerStatus) string {
+	if status == nil {
+		return ""
+	}
+	switch {
+	case status.State.Running != nil:
+		return "running"
+	case status.State.Terminated != nil:
+		return "terminated"
+	case status.State.Waiting != nil:
+		return "waiting"
+	default:
 		return ""
 	}
-	return cStatus.ContainerID
+}
+
+// podContainerResourceNames are the only resource kinds surfaced as meta
+// labels; a pod can request arbitrary extended resources, but cpu/memory/
+// ephemeral-storage are the ones operators relabel on in practice.
+var podContainerResourceNames = []apiv1.ResourceName{
+	apiv1.ResourceCPU,
+	apiv1.ResourceMemory,
+	apiv1.ResourceEphemeralStorage,
+}
+
+func addContainerResourceLabels(ls model.LabelSet, labelPrefix string, rl apiv1.ResourceList) {
+	for _, name := range podContainerResourceNames {
+		qty, ok := rl[name]
+		if !ok {
+			continue
+		}
+		ln := strutil.SanitizeLabelName(string(name))
+		ls[model.LabelName(labelPrefix+ln)] = lv(qty.String())
+	}
+}
+
+// podContainer is a view over apiv1.Container/apiv1.EphemeralContainer that
+// buildPod can treat uniformly regardless of which Spec slice it came from.
+type podContainer struct {
+	name        string
+	image       string
+	ports       []apiv1.ContainerPort
+	resources   apiv1.ResourceRequirements
+	isInit      bool
+	isEphemeral bool
 }
 
 func (p *Pod) buildPod(pod *apiv1.Pod) *targetgroup.Group {
@@ -297,55 +424,153 @@ func (p *Pod) buildPod(pod *apiv1.Pod) *targetgroup.Group {
 
 	tg.Labels = podLabels(pod)
 	tg.Labels[namespaceLabel] = lv(pod.Namespace)
-	if p.withNodeMetadata {
+	if p.withNodeMetadata() {
 		tg.Labels = addNodeLabels(tg.Labels, p.nodeInf, p.logger, &pod.Spec.NodeName)
+		if node, err := p.node(pod.Spec.NodeName); err != nil {
+			level.Error(p.logger).Log("msg", "Error getting node", "node", pod.Spec.NodeName, "err", err)
+		} else if node != nil {
+			addVirtualKubeletLabels(tg.Labels, node)
+		}
 	}
 
-	containers := append(pod.Spec.Containers, pod.Spec.InitContainers...)
-	for i, c := range containers {
-		isInit := i >= len(pod.Spec.Containers)
+	var containers []podContainer
+	for _, c := range pod.Spec.Containers {
+		containers = append(containers, podContainer{name: c.Name, image: c.Image, ports: c.Ports, resources: c.Resources})
+	}
+	for _, c := range pod.Spec.InitContainers {
+		containers = append(containers, podContainer{name: c.Name, image: c.Image, ports: c.Ports, resources: c.Resources, isInit: true})
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		containers = append(containers, podContainer{
+			name: c.Name, image: c.Image, ports: c.Ports, resources: c.Resources, isEphemeral: true,
+		})
+	}
 
-		cStatuses := &pod.Status.ContainerStatuses
-		if isInit {
+	for _, c := range containers {
+		var cStatuses *[]apiv1.ContainerStatus
+		switch {
+		case c.isEphemeral:
+			cStatuses = &pod.Status.EphemeralContainerStatuses
+		case c.isInit:
 			cStatuses = &pod.Status.InitContainerStatuses
+		default:
+			cStatuses = &pod.Status.ContainerStatuses
+		}
+		cStatus, err := p.findPodContainerStatus(cStatuses, c.name)
+		if err != nil {
+			level.Debug(p.logger).Log("msg", "cannot find container ID", "err", err)
+		}
+		var cID string
+		if cStatus != nil {
+			cID = cStatus.ContainerID
 		}
-		cID := p.findPodContainerID(cStatuses, c.Name)
+
+		ls := model.LabelSet{
+			podContainerNameLabel:      lv(c.name),
+			podContainerIDLabel:        lv(cID),
+			podContainerImageLabel:     lv(c.image),
+			podContainerIsInit:         lv(strconv.FormatBool(c.isInit)),
+			podContainerEphemeralLabel: lv(strconv.FormatBool(c.isEphemeral)),
+		}
+		if state := containerStateLabel(cStatus); state != "" {
+			ls[podContainerStateLabel] = lv(state)
+		}
+		if cStatus != nil {
+			ls[podContainerReadyLabel] = lv(strconv.FormatBool(cStatus.Ready))
+			ls[podContainerRestartCountLabel] = lv(strconv.FormatInt(int64(cStatus.RestartCount), 10))
+			if r := cStatus.State.Running; r != nil {
+				ls[podContainerStartedAtLabel] = lv(r.StartedAt.Format(time.RFC3339))
+			}
+		}
+		addContainerResourceLabels(ls, podContainerResourceRequestsPrefix, c.resources.Requests)
+		addContainerResourceLabels(ls, podContainerResourceLimitsPrefix, c.resources.Limits)
 
 		// If no ports are defined for the container, create an anonymous
 		// target per container.
-		if len(c.Ports) == 0 {
+		if len(c.ports) == 0 {
 			// We don't have a port so we just set the address label to the pod IP.
 			// The user has to add a port manually.
-			tg.Targets = append(tg.Targets, model.LabelSet{
-				model.AddressLabel:     lv(pod.Status.PodIP),
-				podContainerNameLabel:  lv(c.Name),
-				podContainerIDLabel:    lv(cID),
-				podContainerImageLabel: lv(c.Image),
-				podContainerIsInit:     lv(strconv.FormatBool(isInit)),
-			})
+			tg.Targets = append(tg.Targets, mergeAddressLabel(ls, lv(pod.Status.PodIP)))
 			continue
 		}
 		// Otherwise create one target for each container/port combination.
-		for _, port := range c.Ports {
+		for _, port := range c.ports {
 			ports := strconv.FormatUint(uint64(port.ContainerPort), 10)
 			addr := net.JoinHostPort(pod.Status.PodIP, ports)
 
-			tg.Targets = append(tg.Targets, model.LabelSet{
-				model.AddressLabel:            lv(addr),
-				podContainerNameLabel:         lv(c.Name),
-				podContainerIDLabel:           lv(cID),
-				podContainerImageLabel:        lv(c.Image),
-				podContainerPortNumberLabel:   lv(ports),
-				podContainerPortNameLabel:     lv(port.Name),
-				podContainerPortProtocolLabel: lv(string(port.Protocol)),
-				podContainerIsInit:            lv(strconv.FormatBool(isInit)),
-			})
+			portLs := mergeAddressLabel(ls, lv(addr))
+			portLs[podContainerPortNumberLabel] = lv(ports)
+			portLs[podContainerPortNameLabel] = lv(port.Name)
+			portLs[podContainerPortProtocolLabel] = lv(string(port.Protocol))
+			tg.Targets = append(tg.Targets, portLs)
 		}
 	}
 
 	return tg
 }
 
+// mergeAddressLabel returns a copy of ls with model.AddressLabel set to
+// addr, so the same base label set can be reused for several targets (e.g.
+// one per container port) without aliasing.
+func mergeAddressLabel(ls model.LabelSet, addr model.LabelValue) model.LabelSet {
+	out := make(model.LabelSet, len(ls)+1)
+	for k, v := range ls {
+		out[k] = v
+	}
+	out[model.AddressLabel] = addr
+	return out
+}
+
+// node looks up a node by name from the pod discoverer's node informer
+// cache. It returns a nil node, nil error if the node isn't known yet.
+func (p *Pod) node(nodeName string) (*apiv1.Node, error) {
+	obj, exists, err := p.nodeInf.GetStore().GetByKey(nodeName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+	return obj.(*apiv1.Node), nil
+}
+
+// addVirtualKubeletLabels detects whether node is backed by a virtual-kubelet
+// provider (ACI, Fargate, Aliyun ECI, ...) rather than a regular kubelet, and
+// annotates ls accordingly so users can relabel-drop or route scraping
+// differently for pods that don't expose /metrics on PodIP:port the same way.
+func addVirtualKubeletLabels(ls model.LabelSet, node *apiv1.Node) {
+	isVirtual := node.Labels[virtualKubeletNodeTypeLabel] == virtualKubeletNodeTypeValue
+	provider := ""
+
+	var taints []string
+	for _, t := range node.Spec.Taints {
+		taints = append(taints, t.Key)
+		if t.Key == virtualKubeletProviderTaint {
+			isVirtual = true
+			if provider == "" {
+				provider = t.Value
+			}
+		}
+	}
+
+	for prefix, name := range virtualKubeletProviderIDPrefixes {
+		if strings.HasPrefix(node.Spec.ProviderID, prefix) {
+			isVirtual = true
+			if provider == "" {
+				provider = name
+			}
+		}
+	}
+
+	ls[podVirtualLabel] = lv(strconv.FormatBool(isVirtual))
+	if provider != "" {
+		ls[podVirtualProviderLabel] = lv(provider)
+	}
+	if len(taints) > 0 {
+		ls[podNodeTaintsLabel] = lv(strings.Join(taints, ","))
+	}
+}
+
 func (p *Pod) enqueuePodsForNode(nodeName string) {
 	pods, err := p.podInf.GetIndexer().ByIndex(nodeIndex, nodeName)
 	if err != nil {
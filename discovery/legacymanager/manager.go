@@ -14,6 +14,7 @@
 package legacymanager
 
 import (
+	"container/heap"
 	"context"
 	"fmt"
 	"reflect"
@@ -23,6 +24,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
 
 	"github.com/prometheus/prometheus/discovery"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
@@ -64,10 +66,24 @@ var (
 		},
 		[]string{"name"},
 	)
+	refreshFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prometheus_sd_refresh_failures_total",
+			Help: "Number of refreshes that failed for a provider and left its previous targets in place.",
+		},
+		[]string{"name"},
+	)
+	lastSuccessfulRefresh = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "prometheus_sd_last_successful_refresh_timestamp_seconds",
+			Help: "Timestamp of the last successful refresh of any provider of the discovery manager.",
+		},
+		[]string{"name"},
+	)
 )
 
 func RegisterMetrics() {
-	prometheus.MustRegister(failedConfigs, discoveredTargets, receivedUpdates, delayedUpdates, sentUpdates)
+	prometheus.MustRegister(failedConfigs, discoveredTargets, receivedUpdates, delayedUpdates, sentUpdates, refreshFailures, lastSuccessfulRefresh)
 }
 
 type poolKey struct {
@@ -77,10 +93,47 @@ type poolKey struct {
 
 // provider holds a Discoverer instance, its configuration and its subscribers.
 type provider struct {
-	name   string // provider名称，格式：fmt.Sprintf("%s/%d", typ, len(m.providers))
+	name   string // provider名称，格式：fmt.Sprintf("%s/%d", typ, m.providerSeq)
 	d      discovery.Discoverer
 	subs   []string // string切片，存放job名称，因为可能不同job下存在一致的服务发现配置，就只会生成一个provider，然后subs存放job列表；
 	config interface{}
+
+	// cancel stops the Discoverer's Run goroutine. It is nil until the
+	// provider has been started once.
+	cancel context.CancelFunc
+	// newSubs accumulates the setNames that reference this provider during
+	// the ApplyConfig call currently in progress. ApplyConfig promotes it to
+	// subs once every incoming Config has been matched against providers;
+	// a provider left with no newSubs is no longer wanted and gets canceled.
+	newSubs []string
+
+	// lastSuccess is the time of this provider's last error-free refresh. It
+	// is the zero Value until the first one completes. Guarded by Manager.mtx.
+	lastSuccess time.Time
+}
+
+// scheduleEntry is one setName's next-eligible-send time, tracked by
+// sender's min-heap.
+type scheduleEntry struct {
+	setName string
+	at      time.Time
+}
+
+// scheduleHeap orders scheduleEntry by at, earliest first.
+type scheduleHeap []scheduleEntry
+
+func (h scheduleHeap) Len() int           { return len(h) }
+func (h scheduleHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h scheduleHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *scheduleHeap) Push(x interface{}) { *h = append(*h, x.(scheduleEntry)) }
+
+func (h *scheduleHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	*h = old[:n-1]
+	return entry
 }
 
 // NewManager is the Discovery Manager constructor.
@@ -89,13 +142,16 @@ func NewManager(ctx context.Context, logger log.Logger, options ...func(*Manager
 		logger = log.NewNopLogger()
 	}
 	mgr := &Manager{
-		logger:         logger,
-		syncCh:         make(chan map[string][]*targetgroup.Group),
-		targets:        make(map[poolKey]map[string]*targetgroup.Group),
-		discoverCancel: []context.CancelFunc{},
-		ctx:            ctx,
-		updatert:       5 * time.Second,
-		triggerSend:    make(chan struct{}, 1),
+		logger:       logger,
+		syncCh:       make(chan map[string][]*targetgroup.Group),
+		targets:      make(map[poolKey]map[string]*targetgroup.Group),
+		ctx:          ctx,
+		updatert:     5 * time.Second,
+		wake:         make(chan struct{}, 1),
+		pending:      make(map[string]bool),
+		scheduled:    make(map[string]bool),
+		nextEligible: make(map[string]time.Time),
+		intervals:    make(map[string]time.Duration),
 	}
 	for _, option := range options {
 		option(mgr)
@@ -112,29 +168,116 @@ func Name(n string) func(*Manager) {
 	}
 }
 
+// StalenessLimit configures how long a provider may keep serving its last
+// known-good targets after a refresh starts failing before the manager
+// gives up on that data and clears it. The zero value (the default) disables
+// staleness expiry: a provider that never recovers keeps reporting its last
+// known-good targets indefinitely, which is almost always preferable to
+// scrape targets disappearing because of a transient SD outage.
+func StalenessLimit(d time.Duration) func(*Manager) {
+	return func(m *Manager) {
+		m.mtx.Lock()
+		defer m.mtx.Unlock()
+		m.staleLimit = d
+	}
+}
+
+// WithUpdateInterval overrides the minimum time between syncCh sends for
+// specific setNames, so a fleet mixing a handful of high-churn jobs with
+// thousands of quasi-static targets doesn't have to pick one throttle value
+// for both. A setName absent from intervals keeps using the manager's
+// default interval.
+func WithUpdateInterval(intervals map[string]time.Duration) func(*Manager) {
+	return func(m *Manager) {
+		for setName, d := range intervals {
+			m.UpdateInterval(setName, d)
+		}
+	}
+}
+
 // Manager maintains a set of discovery providers and sends each update to a map channel.
 // Targets are grouped by the target set name.
 type Manager struct {
-	logger         log.Logger
-	name           string
-	mtx            sync.RWMutex
-	ctx            context.Context
-	discoverCancel []context.CancelFunc
+	logger log.Logger
+	name   string
+	mtx    sync.RWMutex
+	ctx    context.Context
 
 	// Some Discoverers(eg. k8s) send only the updates for a given target group
 	// so we use map[tg.Source]*targetgroup.Group to know which group to update.
 	targets map[poolKey]map[string]*targetgroup.Group
 	// providers keeps track of SD providers.
 	providers []*provider
-	// The sync channel sends the updates as a map where the key is the job value from the scrape config.
+	// The sync channel sends updates as a map keyed by setName, containing
+	// only the setNames that changed since the previous send (see sender).
 	syncCh chan map[string][]*targetgroup.Group
 
-	// How long to wait before sending updates to the channel. The variable
-	// should only be modified in unit tests.
+	// The default interval to wait before sending updates for a setName to
+	// the channel, used for any setName with no entry in intervals. The
+	// variable should only be modified in unit tests.
 	updatert time.Duration
 
-	// The triggerSend channel signals to the manager that new updates have been received from providers.
-	triggerSend chan struct{}
+	// intervals overrides updatert per setName. Set via the
+	// WithUpdateInterval option or the UpdateInterval method.
+	intervals map[string]time.Duration
+
+	// staleLimit is how long a provider may serve stale (error-withheld)
+	// targets before the manager clears them. Zero disables expiry. Set via
+	// the StalenessLimit option.
+	staleLimit time.Duration
+
+	// schedMtx guards pending, scheduled, nextEligible and schedule; kept
+	// separate from mtx so sender's bookkeeping doesn't contend with reads
+	// and writes of targets and providers.
+	schedMtx sync.Mutex
+	// pending marks setNames that received new target data since they were
+	// last sent on syncCh.
+	pending map[string]bool
+	// scheduled marks setNames that already have an entry waiting in
+	// schedule, so a burst of updates for the same setName doesn't queue it
+	// more than once.
+	scheduled map[string]bool
+	// nextEligible is the earliest time each setName may be sent again,
+	// anchoring its throttle interval independently of every other setName.
+	nextEligible map[string]time.Time
+	// schedule is a min-heap of setNames waiting to become eligible to
+	// send, ordered by nextEligible time.
+	schedule scheduleHeap
+	// wake signals sender that a setName was newly marked pending, in case
+	// it is now the earliest entry in schedule.
+	wake chan struct{}
+
+	// providerSeq is a monotonic counter used to name newly started
+	// providers. It must not be derived from len(m.providers): once kept
+	// providers can survive a reload the slice shrinks and grows instead of
+	// only growing, so len is no longer unique across the manager's
+	// lifetime and two live providers could end up sharing a name.
+	providerSeq int
+}
+
+// UpdateInterval overrides the minimum time between syncCh sends for
+// setName. A zero or negative d reverts setName to the manager's default
+// interval. Safe to call while the Manager is running.
+func (m *Manager) UpdateInterval(setName string, d time.Duration) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if d <= 0 {
+		delete(m.intervals, setName)
+		return
+	}
+	m.intervals[setName] = d
+}
+
+// intervalFor returns the configured send interval for setName: its
+// override from intervals if one was set, otherwise the manager's default.
+func (m *Manager) intervalFor(setName string) time.Duration {
+	m.mtx.RLock()
+	d, ok := m.intervals[setName]
+	m.mtx.RUnlock()
+	if ok {
+		return d
+	}
+	return m.updatert
 }
 
 // Run starts the background processing
@@ -147,43 +290,106 @@ func (m *Manager) Run() error {
 	return nil
 }
 
-// SyncCh returns a read only channel used by all the clients to receive target updates.
+// SyncCh returns a read only channel used by all the clients to receive
+// target updates. Each value is a delta: it only contains the setNames that
+// changed since the previous send, not a full snapshot of every setName.
+//
+// This is a behavior change from a plain full-snapshot channel: a consumer
+// that still replaces its entire view of the world on every receive will
+// drop every setName absent from a given delta instead of leaving it
+// untouched. Callers must merge each delta into their own per-setName state
+// (e.g. keyed by setName, overwriting only the keys present in the delta)
+// rather than treating a receive as the complete set of target groups.
 func (m *Manager) SyncCh() <-chan map[string][]*targetgroup.Group {
 	return m.syncCh
 }
 
-// ApplyConfig removes all running discovery providers and starts new ones using the provided config.
+// ApplyConfig diffs cfg against the currently running providers: a provider
+// whose Config is unchanged keeps running (and just has its subscriber list
+// updated), only providers whose Config disappeared are canceled, and only
+// genuinely new Configs start a new Discoverer. This avoids a full re-scrape
+// stampede and temporary target loss on every reload in deployments with
+// many jobs and large target counts.
 func (m *Manager) ApplyConfig(cfg map[string]discovery.Configs) error {
-	// 加锁
 	m.mtx.Lock()
-	// 函数结束后 解锁
 	defer m.mtx.Unlock()
 
-	// 遍历已存在的target
 	for pk := range m.targets {
 		if _, ok := cfg[pk.setName]; !ok {
-			// 删除标签
 			discoveredTargets.DeleteLabelValues(m.name, pk.setName)
 		}
 	}
-	// 取消所有Discoverer
-	m.cancelDiscoverers()
-	m.targets = make(map[poolKey]map[string]*targetgroup.Group)
-	m.providers = nil
-	m.discoverCancel = nil
 
-	failedCount := 0
-	for name, scfg := range cfg {
-		// 根据scfg，注册服务发现实例
-		failedCount += m.registerProviders(scfg, name)
-		// 设置标签
+	// Every provider starts this round believing nobody wants it; registerProviders
+	// repopulates newSubs for every provider still referenced by cfg.
+	for _, p := range m.providers {
+		p.newSubs = nil
+	}
+
+	for name := range cfg {
 		discoveredTargets.WithLabelValues(m.name, name).Set(0)
 	}
+	failedCount := m.registerProviders(cfg)
 	failedConfigs.WithLabelValues(m.name).Set(float64(failedCount))
 
-	for _, prov := range m.providers {
-		// 启动服务发现实例
-		m.startProvider(m.ctx, prov)
+	var kept []*provider
+	for _, p := range m.providers {
+		if len(p.newSubs) == 0 {
+			// No job references this provider's config anymore.
+			if p.cancel != nil {
+				p.cancel()
+			}
+			for pk := range m.targets {
+				if pk.provider == p.name {
+					delete(m.targets, pk)
+				}
+			}
+			continue
+		}
+
+		// The provider is kept, but drop targets for any setName that used
+		// to share it and no longer does.
+		wantSub := make(map[string]bool, len(p.newSubs))
+		for _, s := range p.newSubs {
+			wantSub[s] = true
+		}
+		for pk := range m.targets {
+			if pk.provider == p.name && !wantSub[pk.setName] {
+				delete(m.targets, pk)
+			}
+		}
+
+		// A setName that newly started sharing an already-running provider
+		// won't see any targets until the provider's next refresh, which a
+		// static/one-shot Discoverer (or an already-synced informer with no
+		// reason to re-list) may never do. Seed it with the provider's
+		// current data now instead of leaving it empty until then.
+		if p.cancel != nil {
+			hadSub := make(map[string]bool, len(p.subs))
+			for _, s := range p.subs {
+				hadSub[s] = true
+			}
+			var added []string
+			for _, s := range p.newSubs {
+				if !hadSub[s] {
+					added = append(added, s)
+				}
+			}
+			if len(added) > 0 {
+				m.resyncAddedSubs(p, added)
+			}
+		}
+
+		p.subs = p.newSubs
+		kept = append(kept, p)
+	}
+	m.providers = kept
+
+	for _, p := range m.providers {
+		if p.cancel == nil {
+			// Newly registered this round; everything else was already running.
+			m.startProvider(m.ctx, p)
+		}
 	}
 
 	return nil
@@ -205,8 +411,9 @@ func (m *Manager) startProvider(ctx context.Context, p *provider) {
 	ctx, cancel := context.WithCancel(ctx)
 	// 记录发现的服务
 	updates := make(chan []*targetgroup.Group)
-	// 添加取消方法
-	m.discoverCancel = append(m.discoverCancel, cancel)
+	// Stash the cancel func on the provider itself so ApplyConfig can stop
+	// this one Discoverer without touching the others.
+	p.cancel = cancel
 	// 执行run  每个服务发现都有自己的run方法。
 	// 这里是给服务发现 往updates这个channel中传数据
 	go p.d.Run(ctx, updates)
@@ -226,56 +433,182 @@ func (m *Manager) updater(ctx context.Context, p *provider, updates chan []*targ
 				level.Debug(m.logger).Log("msg", "Discoverer channel closed", "provider", p.name)
 				return
 			}
+			m.recordRefresh(p, tgs)
 			// 更新targets
 			for _, s := range p.subs {
 				m.updateGroup(poolKey{setName: s, provider: p.name}, tgs)
 			}
+			m.markPending(p.subs)
+		}
+	}
+}
 
-			select {
-			// 发送更新通知
-			case m.triggerSend <- struct{}{}:
-			default:
+// markPending flags each setName in subs as having new data to send and, if
+// it isn't already waiting in schedule, queues it to become eligible as
+// soon as its throttle interval (see intervalFor) allows.
+func (m *Manager) markPending(subs []string) {
+	m.enqueue(subs, func(s string, now time.Time) time.Time {
+		at := m.nextEligible[s]
+		if at.Before(now) {
+			at = now
+		}
+		return at
+	})
+}
+
+// enqueue flags each setName in subs as pending and, if it isn't already
+// waiting in schedule, pushes it with an eligible time computed by atFor,
+// then wakes sender.
+func (m *Manager) enqueue(subs []string, atFor func(setName string, now time.Time) time.Time) {
+	m.schedMtx.Lock()
+	now := time.Now()
+	for _, s := range subs {
+		m.pending[s] = true
+		if m.scheduled[s] {
+			continue
+		}
+		m.scheduled[s] = true
+		heap.Push(&m.schedule, scheduleEntry{setName: s, at: atFor(s, now)})
+	}
+	m.schedMtx.Unlock()
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// recordRefresh updates p's success bookkeeping for this batch of target
+// groups. A batch is considered failed if any Group in it carries
+// discovery.ErrorMetaLabel; updateGroup is responsible for keeping that
+// Group's Source untouched in m.targets. If the provider has been failing
+// for longer than staleLimit, its stale targets are dropped instead of kept
+// around forever.
+func (m *Manager) recordRefresh(p *provider, tgs []*targetgroup.Group) {
+	errored := false
+	for _, tg := range tgs {
+		if tg == nil {
+			continue
+		}
+		if _, ok := tg.Labels[model.LabelName(discovery.ErrorMetaLabel)]; ok {
+			errored = true
+			break
+		}
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if !errored {
+		p.lastSuccess = time.Now()
+		lastSuccessfulRefresh.WithLabelValues(m.name).Set(float64(p.lastSuccess.Unix()))
+		return
+	}
+
+	refreshFailures.WithLabelValues(m.name).Inc()
+	if m.staleLimit > 0 && !p.lastSuccess.IsZero() && time.Since(p.lastSuccess) > m.staleLimit {
+		level.Warn(m.logger).Log("msg", "Provider has been failing to refresh for longer than the staleness limit, dropping its targets", "provider", p.name, "staleness_limit", m.staleLimit)
+		var affected []string
+		for pk := range m.targets {
+			if pk.provider == p.name {
+				delete(m.targets, pk)
+				affected = append(affected, pk.setName)
 			}
 		}
+		if len(affected) > 0 {
+			// Dropping the map entries above is invisible to sender on its
+			// own: without marking these setNames pending, nothing schedules
+			// a syncCh send and the scrape side keeps the stale targets
+			// until its next successful refresh happens to re-mark them.
+			m.markPending(affected)
+		}
 	}
 }
 
-// 这段代码 让我对channel通信有了新的认识
-// 1。 for循环里面套用这么多select
-// 2。 triggerSend 明明是等待别人发数据来，为啥，还往里面丢一个数据？
-//
-//	其实是为了这次处理，会一直循环等待处理。等待syncCh拿到数据
+// sender waits for the earliest entry in schedule to become eligible and
+// coalesces every setName that's ready at that point into a single syncCh
+// send, so a burst of updates across many jobs in the same window produces
+// one delta instead of one send per job.
 func (m *Manager) sender() {
-	ticker := time.NewTicker(m.updatert)
-	defer ticker.Stop()
-
 	for {
+		m.schedMtx.Lock()
+		empty := m.schedule.Len() == 0
+		var wait time.Duration
+		if !empty {
+			wait = time.Until(m.schedule[0].at)
+		}
+		m.schedMtx.Unlock()
+
+		if empty {
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-m.wake:
+			}
+			continue
+		}
+		if wait < 0 {
+			wait = 0
+		}
+
+		timer := time.NewTimer(wait)
 		select {
 		case <-m.ctx.Done():
+			timer.Stop()
 			return
-		case <-ticker.C: // Some discoverers send updates too often so we throttle these with the ticker.
-			select {
-			case <-m.triggerSend:
-				sentUpdates.WithLabelValues(m.name).Inc()
-				select {
-				case m.syncCh <- m.allGroups():
-				default:
-					delayedUpdates.WithLabelValues(m.name).Inc()
-					level.Debug(m.logger).Log("msg", "Discovery receiver's channel was full so will retry the next cycle")
-					select {
-					case m.triggerSend <- struct{}{}:
-					default:
-					}
-				}
-			default:
-			}
+		case <-m.wake:
+			// A new setName may now be earlier than the one we were
+			// waiting on; re-peek the heap instead of firing stale.
+			timer.Stop()
+			continue
+		case <-timer.C:
+		}
+
+		due, delta := m.collectDue()
+		if len(delta) == 0 {
+			// No setName was due after all. groupsFor returns an entry,
+			// possibly empty, for every due setName, so the delta is only
+			// empty when due is.
+			continue
 		}
+		sentUpdates.WithLabelValues(m.name).Inc()
+		select {
+		case m.syncCh <- delta:
+			m.commitSent(due)
+		default:
+			delayedUpdates.WithLabelValues(m.name).Inc()
+			level.Debug(m.logger).Log("msg", "Discovery receiver's channel was full so will retry the next cycle")
+			// Back off by each setName's own interval instead of spinning:
+			// nextEligible wasn't advanced for this batch (commitSent only
+			// runs on the success path above), so requeuing through
+			// markPending would hand them straight back to sender with
+			// at==now and busy-loop until the receiver drains.
+			m.retryAfter(due)
+		}
+	}
+}
+
+// retryAfter re-schedules each setName in due to become eligible again
+// after its own configured interval and marks it pending so the retry
+// carries the same outstanding data forward, used when a syncCh send was
+// dropped because the receiver's channel was full.
+func (m *Manager) retryAfter(due []string) {
+	// Look the intervals up before enqueue takes schedMtx: intervalFor takes
+	// mtx, and recordRefresh/ApplyConfig take schedMtx while holding mtx.
+	intervals := make(map[string]time.Duration, len(due))
+	for _, s := range due {
+		intervals[s] = m.intervalFor(s)
 	}
+	m.enqueue(due, func(s string, now time.Time) time.Time {
+		return now.Add(intervals[s])
+	})
 }
 
 func (m *Manager) cancelDiscoverers() {
-	for _, c := range m.discoverCancel {
-		c()
+	for _, p := range m.providers {
+		if p.cancel != nil {
+			p.cancel()
+		}
 	}
 }
 
@@ -287,19 +620,106 @@ func (m *Manager) updateGroup(poolKey poolKey, tgs []*targetgroup.Group) {
 		m.targets[poolKey] = make(map[string]*targetgroup.Group)
 	}
 	for _, tg := range tgs {
-		if tg != nil { // Some Discoverers send nil target group so need to check for it to avoid panics.
-			m.targets[poolKey][tg.Source] = tg
+		if tg == nil { // Some Discoverers send nil target group so need to check for it to avoid panics.
+			continue
+		}
+		if _, ok := tg.Labels[model.LabelName(discovery.ErrorMetaLabel)]; ok {
+			// This Source failed to refresh; keep whatever we already have
+			// for it instead of replacing it with an empty/partial Group.
+			continue
 		}
+		m.targets[poolKey][tg.Source] = tg
+	}
+}
+
+// resyncAddedSubs copies p's existing target data onto each setName in
+// added, which just started subscribing to p without the provider itself
+// re-emitting anything, and marks them pending so the copy actually reaches
+// syncCh on the next send rather than sitting unseen until p's next refresh.
+func (m *Manager) resyncAddedSubs(p *provider, added []string) {
+	var groups map[string]*targetgroup.Group
+	for pk, g := range m.targets {
+		if pk.provider == p.name {
+			groups = g
+			break
+		}
+	}
+	if groups == nil {
+		return
+	}
+	for _, s := range added {
+		copied := make(map[string]*targetgroup.Group, len(groups))
+		for k, v := range groups {
+			copied[k] = v
+		}
+		m.targets[poolKey{setName: s, provider: p.name}] = copied
+	}
+	m.markPending(added)
+}
+
+// collectDue pops every schedule entry whose time has arrived and clears
+// their pending/scheduled flags, so the next update for that setName queues
+// a fresh entry. It returns the due setNames alongside their current data;
+// nextEligible isn't advanced until commitSent confirms the send succeeded.
+func (m *Manager) collectDue() ([]string, map[string][]*targetgroup.Group) {
+	now := time.Now()
+
+	m.schedMtx.Lock()
+	var due []string
+	for m.schedule.Len() > 0 && !m.schedule[0].at.After(now) {
+		entry := heap.Pop(&m.schedule).(scheduleEntry)
+		due = append(due, entry.setName)
+		delete(m.scheduled, entry.setName)
+		delete(m.pending, entry.setName)
+	}
+	m.schedMtx.Unlock()
+
+	if len(due) == 0 {
+		return nil, nil
 	}
+	return due, m.groupsFor(due)
 }
 
-func (m *Manager) allGroups() map[string][]*targetgroup.Group {
+// commitSent arms each of the given setNames' next-eligible time now that
+// their data was actually delivered on syncCh.
+func (m *Manager) commitSent(due []string) {
+	now := time.Now()
+	// intervalFor takes mtx, so it must not be called under schedMtx.
+	next := make(map[string]time.Time, len(due))
+	for _, s := range due {
+		next[s] = now.Add(m.intervalFor(s))
+	}
+	m.schedMtx.Lock()
+	for s, at := range next {
+		m.nextEligible[s] = at
+	}
+	m.schedMtx.Unlock()
+}
+
+// groupsFor returns the current target groups for each of the given
+// setNames, keyed by setName, and refreshes discoveredTargets for them.
+func (m *Manager) groupsFor(setNames []string) map[string][]*targetgroup.Group {
 	m.mtx.RLock()
 	defer m.mtx.RUnlock()
 
+	want := make(map[string]bool, len(setNames))
+	for _, s := range setNames {
+		want[s] = true
+	}
+
 	tSets := map[string][]*targetgroup.Group{}
 	n := map[string]int{}
+	// Pre-populate every requested setName, even ones with no poolKey left
+	// in m.targets (e.g. just cleared past the staleness limit), so the
+	// delta this feeds still carries an (empty) entry for it instead of
+	// silently omitting it, which would look like "unchanged" downstream.
+	for _, s := range setNames {
+		tSets[s] = nil
+	}
 	for pkey, tsets := range m.targets {
+		if !want[pkey.setName] {
+			continue
+		}
 		for _, tg := range tsets {
 			// Even if the target group 'tg' is empty we still need to send it to the 'Scrape manager'
 			// to signal that it needs to stop all scrape loops for this target set.
@@ -307,71 +727,144 @@ func (m *Manager) allGroups() map[string][]*targetgroup.Group {
 			n[pkey.setName] += len(tg.Targets)
 		}
 	}
-	for setName, v := range n {
-		discoveredTargets.WithLabelValues(m.name, setName).Set(float64(v))
+	for _, s := range setNames {
+		discoveredTargets.WithLabelValues(m.name, s).Set(float64(n[s]))
 	}
 	return tSets
 }
 
-// registerProviders returns a number of failed SD config.
-func (m *Manager) registerProviders(cfgs discovery.Configs, setName string) int {
-	// 标签
-	var (
-		failed int
-		added  bool
-	)
-	// 加载Providers的add方法
-	add := func(cfg discovery.Config) {
-		// 读取cfg类型
-		for _, p := range m.providers {
-			// 检查该cfg是否加载过
-			if reflect.DeepEqual(cfg, p.config) {
-				// 如果加载过，记录该Job
-				p.subs = append(p.subs, setName)
-				// 变更标签状态
-				added = true
-				// 跳出
-				return
+// registerProviders matches every (setName, Config) pair across the whole
+// cfg map against m.providers and returns the number of failed SD configs.
+// Matching runs in two passes so a Reconfigure can never steal a provider
+// out from under a setName whose Config is still an exact match for it:
+// pass one claims every provider with an exact Config match across every
+// setName first; only the leftover configs reach pass two, which lets them
+// Reconfigure a same-type provider that pass one left unclaimed
+// (len(newSubs) == 0), rather than whichever same-type provider happens to
+// be first in m.providers.
+func (m *Manager) registerProviders(cfg map[string]discovery.Configs) int {
+	type pending struct {
+		setName string
+		cfg     discovery.Config
+	}
+
+	added := make(map[string]bool, len(cfg))
+	var leftover []pending
+	for setName, cfgs := range cfg {
+		for _, c := range cfgs {
+			if p := m.findExactProvider(c); p != nil {
+				p.newSubs = append(p.newSubs, setName)
+				added[setName] = true
+				continue
+			}
+			leftover = append(leftover, pending{setName: setName, cfg: c})
+		}
+	}
+
+	failed := 0
+	for _, pd := range leftover {
+		// Re-check for an exact match before reaching for Reconfigure: a
+		// provider created or reconfigured earlier in this same leftover
+		// pass may now have an identical Config (e.g. two setNames sharing
+		// a brand-new Config neither had before).
+		if p := m.findExactProvider(pd.cfg); p != nil {
+			p.newSubs = append(p.newSubs, pd.setName)
+			added[pd.setName] = true
+			continue
+		}
+		// Same mechanism, different settings: try to update the running
+		// Discoverer in place instead of tearing it down and restarting it
+		// (and, for something like kubernetes.Pod, rebuilding its informers
+		// and triggering a re-list against the API server).
+		if p := m.findReconfigurableProvider(pd.cfg); p != nil {
+			if err := p.d.(discovery.Reconfigurable).Reconfigure(m.ctx, pd.cfg); err == nil {
+				p.config = pd.cfg
+				p.newSubs = append(p.newSubs, pd.setName)
+				added[pd.setName] = true
+				continue
 			}
 		}
-		typ := cfg.Name()
-		// 创建一个Discoverer实例
-		d, err := cfg.NewDiscoverer(discovery.DiscovererOptions{
-			Logger: log.With(m.logger, "discovery", typ, "config", setName),
-		})
-		if err != nil {
-			level.Error(m.logger).Log("msg", "Cannot create service discovery", "err", err, "type", typ, "config", setName)
+		if m.startNewProvider(pd.cfg, pd.setName) {
+			added[pd.setName] = true
+		} else {
 			failed++
-			return
 		}
-		// 添加该provider到m.provider队列中
-		m.providers = append(m.providers, &provider{
-			// 生成provider名称
-			name: fmt.Sprintf("%s/%d", typ, len(m.providers)),
-			// 关联对应的Discoverer实例， （比如DNS，zk，K8等）
-			d: d,
-			// 关联配置
-			config: cfg,
-			// 关联job
-			subs: []string{setName},
-		})
-		// 更新标签
-		added = true
-	}
-	for _, cfg := range cfgs {
-		add(cfg)
-	}
-	if !added {
+	}
+
+	for setName := range cfg {
+		if added[setName] {
+			continue
+		}
 		// Add an empty target group to force the refresh of the corresponding
 		// scrape pool and to notify the receiver that this target set has no
 		// current targets.
 		// It can happen because the combined set of SD configurations is empty
 		// or because we fail to instantiate all the SD configurations.
-		add(discovery.StaticConfig{{}})
+		fallback := discovery.Config(discovery.StaticConfig{{}})
+		if p := m.findExactProvider(fallback); p != nil {
+			p.newSubs = append(p.newSubs, setName)
+			continue
+		}
+		if !m.startNewProvider(fallback, setName) {
+			failed++
+		}
 	}
 	return failed
 }
 
+// findExactProvider returns the first provider whose Config is deeply equal
+// to cfg, or nil if none matches.
+func (m *Manager) findExactProvider(cfg discovery.Config) *provider {
+	for _, p := range m.providers {
+		if reflect.DeepEqual(cfg, p.config) {
+			return p
+		}
+	}
+	return nil
+}
+
+// findReconfigurableProvider returns the first provider of the same SD type
+// as cfg that hasn't been claimed yet this round (len(newSubs) == 0, which
+// also means it wasn't an exact match for any other incoming config) and
+// whose Discoverer supports Reconfigure in place, or nil if none matches.
+func (m *Manager) findReconfigurableProvider(cfg discovery.Config) *provider {
+	for _, p := range m.providers {
+		if len(p.newSubs) != 0 {
+			continue
+		}
+		pCfg, ok := p.config.(discovery.Config)
+		if !ok || pCfg.Name() != cfg.Name() {
+			continue
+		}
+		if _, ok := p.d.(discovery.Reconfigurable); ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// startNewProvider creates a Discoverer for cfg and registers a new
+// provider subscribed to setName. It logs and returns false if the
+// Discoverer failed to construct.
+func (m *Manager) startNewProvider(cfg discovery.Config, setName string) bool {
+	typ := cfg.Name()
+	d, err := cfg.NewDiscoverer(discovery.DiscovererOptions{
+		Logger: log.With(m.logger, "discovery", typ, "config", setName),
+	})
+	if err != nil {
+		level.Error(m.logger).Log("msg", "Cannot create service discovery", "err", err, "type", typ, "config", setName)
+		return false
+	}
+	m.providers = append(m.providers, &provider{
+		name:    fmt.Sprintf("%s/%d", typ, m.providerSeq),
+		d:       d,
+		config:  cfg,
+		newSubs: []string{setName},
+	})
+	m.providerSeq++
+	return true
+}
+
 // StaticProvider holds a list of target groups that never change.
 type StaticProvider struct {
 	TargetGroups []*targetgroup.Group
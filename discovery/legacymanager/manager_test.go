@@ -0,0 +1,384 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package legacymanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/discovery"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+)
+
+// TestApplyConfigKeepsUnchangedProvider ensures a reload with an identical
+// config doesn't cancel or recreate the running provider, nor lose the
+// targets it already reported.
+func TestApplyConfigKeepsUnchangedProvider(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, nil)
+
+	cfg := map[string]discovery.Configs{"job": {discovery.StaticConfig{{Source: "s1"}}}}
+	require.NoError(t, m.ApplyConfig(cfg))
+	require.Len(t, m.providers, 1)
+	firstName := m.providers[0].name
+	require.NotNil(t, m.providers[0].cancel)
+
+	pk := poolKey{setName: "job", provider: firstName}
+	m.updateGroup(pk, []*targetgroup.Group{{Source: "s1"}})
+
+	require.NoError(t, m.ApplyConfig(cfg))
+
+	require.Len(t, m.providers, 1)
+	require.Equal(t, firstName, m.providers[0].name)
+	require.Contains(t, m.targets, pk)
+}
+
+// TestApplyConfigSharedProviderSubsMutated covers two jobs sharing a
+// provider: dropping one job must not cancel the provider or drop the
+// other job's targets, it should just mutate subs.
+func TestApplyConfigSharedProviderSubsMutated(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, nil)
+
+	shared := discovery.StaticConfig{{Source: "s1"}}
+	cfg := map[string]discovery.Configs{
+		"jobA": {shared},
+		"jobB": {shared},
+	}
+	require.NoError(t, m.ApplyConfig(cfg))
+	require.Len(t, m.providers, 1)
+	name := m.providers[0].name
+
+	m.updateGroup(poolKey{setName: "jobA", provider: name}, []*targetgroup.Group{{Source: "s1"}})
+	m.updateGroup(poolKey{setName: "jobB", provider: name}, []*targetgroup.Group{{Source: "s1"}})
+
+	// Drop jobA; jobB keeps referencing the same static config.
+	require.NoError(t, m.ApplyConfig(map[string]discovery.Configs{"jobB": {shared}}))
+
+	require.Len(t, m.providers, 1)
+	require.Equal(t, name, m.providers[0].name)
+	require.Equal(t, []string{"jobB"}, m.providers[0].subs)
+	require.NotContains(t, m.targets, poolKey{setName: "jobA", provider: name})
+	require.Contains(t, m.targets, poolKey{setName: "jobB", provider: name})
+}
+
+// TestApplyConfigNamesProvidersMonotonically ensures a provider name is
+// never reused after the providers slice shrinks and then grows again. A
+// name derived from len(m.providers) can collide here, and two live
+// providers sharing a name corrupt each other's entries in m.targets.
+func TestApplyConfigNamesProvidersMonotonically(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, nil)
+
+	require.NoError(t, m.ApplyConfig(map[string]discovery.Configs{
+		"jobA": {discovery.StaticConfig{{Source: "a"}}},
+		"jobB": {discovery.StaticConfig{{Source: "b"}}},
+	}))
+	require.Len(t, m.providers, 2)
+
+	// Drop jobA: the providers slice shrinks to one entry.
+	require.NoError(t, m.ApplyConfig(map[string]discovery.Configs{
+		"jobB": {discovery.StaticConfig{{Source: "b"}}},
+	}))
+	require.Len(t, m.providers, 1)
+
+	// Add a brand-new job: a len(m.providers)-based name collides with the
+	// surviving jobB provider's name whenever jobB's provider was named second.
+	require.NoError(t, m.ApplyConfig(map[string]discovery.Configs{
+		"jobB": {discovery.StaticConfig{{Source: "b"}}},
+		"jobC": {discovery.StaticConfig{{Source: "c"}}},
+	}))
+	require.Len(t, m.providers, 2)
+	require.NotEqual(t, m.providers[0].name, m.providers[1].name)
+}
+
+// TestApplyConfigResyncsAddedSubscriberToKeptProvider ensures a setName
+// newly added to an already-running provider sees that provider's current
+// targets right away, instead of waiting for a refresh a static/one-shot
+// Discoverer (or an already-synced informer) will never produce again.
+func TestApplyConfigResyncsAddedSubscriberToKeptProvider(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, nil)
+
+	shared := discovery.StaticConfig{{Source: "s1"}}
+	require.NoError(t, m.ApplyConfig(map[string]discovery.Configs{"jobA": {shared}}))
+	require.Len(t, m.providers, 1)
+	name := m.providers[0].name
+
+	good := []*targetgroup.Group{{Source: "s1", Targets: []model.LabelSet{{"__address__": "1.2.3.4:80"}}}}
+	m.updateGroup(poolKey{setName: "jobA", provider: name}, good)
+
+	// jobB starts sharing jobA's exact config; the provider is kept as-is,
+	// so nothing will make it re-emit for jobB's benefit.
+	require.NoError(t, m.ApplyConfig(map[string]discovery.Configs{
+		"jobA": {shared},
+		"jobB": {shared},
+	}))
+
+	require.Len(t, m.providers, 1)
+	require.ElementsMatch(t, []string{"jobA", "jobB"}, m.providers[0].subs)
+	require.Equal(t, m.targets[poolKey{setName: "jobA", provider: name}], m.targets[poolKey{setName: "jobB", provider: name}])
+
+	m.schedMtx.Lock()
+	pending := m.pending["jobB"]
+	m.schedMtx.Unlock()
+	require.True(t, pending, "jobB must be marked pending so the resynced data reaches syncCh")
+}
+
+// TestApplyConfigFullyReplaced ensures that configs with nothing in common
+// with the previous round cancel the old provider and start a fresh one.
+func TestApplyConfigFullyReplaced(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, nil)
+
+	require.NoError(t, m.ApplyConfig(map[string]discovery.Configs{
+		"job": {discovery.StaticConfig{{Source: "s1"}}},
+	}))
+	require.Len(t, m.providers, 1)
+	oldName := m.providers[0].name
+	m.updateGroup(poolKey{setName: "job", provider: oldName}, []*targetgroup.Group{{Source: "s1"}})
+
+	require.NoError(t, m.ApplyConfig(map[string]discovery.Configs{
+		"job": {discovery.StaticConfig{{Source: "s2"}}},
+	}))
+
+	require.Len(t, m.providers, 1)
+	require.NotEqual(t, oldName, m.providers[0].name)
+	require.NotContains(t, m.targets, poolKey{setName: "job", provider: oldName})
+}
+
+// fakeReconfigurableConfig is a minimal discovery.Config whose Discoverer
+// implements discovery.Reconfigurable, for exercising registerProviders'
+// Reconfigure path without a real SD mechanism.
+type fakeReconfigurableConfig struct {
+	selector string
+}
+
+func (fakeReconfigurableConfig) Name() string { return "fake" }
+
+func (c fakeReconfigurableConfig) NewDiscoverer(discovery.DiscovererOptions) (discovery.Discoverer, error) {
+	return &fakeReconfigurableDiscoverer{selector: c.selector}, nil
+}
+
+type fakeReconfigurableDiscoverer struct {
+	selector string
+}
+
+func (d *fakeReconfigurableDiscoverer) Run(ctx context.Context, up chan<- []*targetgroup.Group) {
+	<-ctx.Done()
+}
+
+func (d *fakeReconfigurableDiscoverer) Reconfigure(_ context.Context, cfg discovery.Config) error {
+	d.selector = cfg.(fakeReconfigurableConfig).selector
+	return nil
+}
+
+// TestApplyConfigDoesNotCrossWireReconfigurableProviders reproduces a
+// maintainer-reported bug: with two providers of the same Reconfigurable SD
+// type, reconfiguring one of them for a changed setName must never steal
+// the *other* provider, whose Config is still an exact match for its own
+// setName.
+func TestApplyConfigDoesNotCrossWireReconfigurableProviders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, nil)
+
+	require.NoError(t, m.ApplyConfig(map[string]discovery.Configs{
+		"jobA": {fakeReconfigurableConfig{selector: "a"}},
+		"jobB": {fakeReconfigurableConfig{selector: "b"}},
+	}))
+	require.Len(t, m.providers, 2)
+
+	var pA, pB *provider
+	for _, p := range m.providers {
+		switch p.config.(fakeReconfigurableConfig).selector {
+		case "a":
+			pA = p
+		case "b":
+			pB = p
+		}
+	}
+	require.NotNil(t, pA)
+	require.NotNil(t, pB)
+
+	// jobB's selector changes; jobA's Config is untouched and must keep
+	// pointing at pA, not get silently reassigned to pB-turned-"b2".
+	require.NoError(t, m.ApplyConfig(map[string]discovery.Configs{
+		"jobA": {fakeReconfigurableConfig{selector: "a"}},
+		"jobB": {fakeReconfigurableConfig{selector: "b2"}},
+	}))
+
+	require.Len(t, m.providers, 2)
+	require.Equal(t, []string{"jobA"}, pA.subs)
+	require.Equal(t, []string{"jobB"}, pB.subs)
+	require.Equal(t, "a", pA.config.(fakeReconfigurableConfig).selector)
+	require.Equal(t, "b2", pB.config.(fakeReconfigurableConfig).selector)
+}
+
+// TestUpdateGroupKeepsLastKnownGoodOnError ensures a Group carrying
+// discovery.ErrorMetaLabel doesn't overwrite the last known-good Group
+// previously reported for the same Source.
+func TestUpdateGroupKeepsLastKnownGoodOnError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, nil)
+
+	pk := poolKey{setName: "job", provider: "static/0"}
+	good := &targetgroup.Group{Source: "s1", Targets: []model.LabelSet{{"__address__": "1.2.3.4:80"}}}
+	m.updateGroup(pk, []*targetgroup.Group{good})
+	require.Equal(t, good, m.targets[pk]["s1"])
+
+	errGroup := &targetgroup.Group{
+		Source: "s1",
+		Labels: model.LabelSet{model.LabelName(discovery.ErrorMetaLabel): "1"},
+	}
+	m.updateGroup(pk, []*targetgroup.Group{errGroup})
+
+	require.Equal(t, good, m.targets[pk]["s1"])
+}
+
+// TestRecordRefreshDropsStaleTargetsPastStalenessLimit ensures a provider
+// that keeps failing past StalenessLimit eventually has its stale targets
+// cleared instead of serving them forever.
+func TestRecordRefreshDropsStaleTargetsPastStalenessLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, nil, StalenessLimit(time.Millisecond))
+
+	p := &provider{name: "static/0"}
+	pk := poolKey{setName: "job", provider: p.name}
+	m.updateGroup(pk, []*targetgroup.Group{{Source: "s1"}})
+	m.recordRefresh(p, []*targetgroup.Group{{Source: "s1"}})
+	require.Contains(t, m.targets, pk)
+
+	errGroup := &targetgroup.Group{
+		Source: "s1",
+		Labels: model.LabelSet{model.LabelName(discovery.ErrorMetaLabel): "1"},
+	}
+	time.Sleep(2 * time.Millisecond)
+	m.recordRefresh(p, []*targetgroup.Group{errGroup})
+
+	require.NotContains(t, m.targets, pk)
+}
+
+// TestRecordRefreshNotifiesSenderPastStalenessLimit ensures dropping a
+// provider's stale targets actually reaches syncCh as an explicit empty
+// update for its setName, not just the internal m.targets map — a consumer
+// that only acts on setNames present in the delta would otherwise keep
+// scraping the stale targets until the next successful refresh.
+func TestRecordRefreshNotifiesSenderPastStalenessLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, nil, StalenessLimit(time.Millisecond))
+	m.updatert = 10 * time.Millisecond
+	go m.sender()
+
+	p := &provider{name: "static/0", subs: []string{"job"}}
+	pk := poolKey{setName: "job", provider: p.name}
+	good := []*targetgroup.Group{{Source: "s1", Targets: []model.LabelSet{{"__address__": "1.2.3.4:80"}}}}
+	m.updateGroup(pk, good)
+	m.recordRefresh(p, good)
+	m.markPending([]string{"job"})
+
+	select {
+	case <-m.syncCh:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for initial sync")
+	}
+
+	errGroup := &targetgroup.Group{
+		Source: "s1",
+		Labels: model.LabelSet{model.LabelName(discovery.ErrorMetaLabel): "1"},
+	}
+	time.Sleep(2 * time.Millisecond)
+	m.recordRefresh(p, []*targetgroup.Group{errGroup})
+
+	select {
+	case delta := <-m.syncCh:
+		groups, present := delta["job"]
+		require.True(t, present, "dropped setName must still appear in the delta")
+		require.Empty(t, groups)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for staleness drop to reach syncCh")
+	}
+}
+
+// TestSenderCoalescesReadySetNames ensures that when two setNames become
+// eligible in the same wakeup, sender delivers them as a single syncCh send
+// containing only those setNames rather than one send per setName.
+func TestSenderCoalescesReadySetNames(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, nil)
+	m.updatert = 10 * time.Millisecond
+	go m.sender()
+
+	m.updateGroup(poolKey{setName: "jobA", provider: "static/0"}, []*targetgroup.Group{{Source: "s1"}})
+	m.updateGroup(poolKey{setName: "jobB", provider: "static/1"}, []*targetgroup.Group{{Source: "s1"}})
+	// Mark both in one call so they are queued together and fall due in the
+	// same sender wakeup.
+	m.markPending([]string{"jobA", "jobB"})
+
+	select {
+	case delta := <-m.syncCh:
+		require.Contains(t, delta, "jobA")
+		require.Contains(t, delta, "jobB")
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for coalesced send")
+	}
+}
+
+// TestSenderHonorsPerSetNameInterval ensures a setName with a
+// WithUpdateInterval override is throttled independently of the manager's
+// default interval.
+func TestSenderHonorsPerSetNameInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, nil, WithUpdateInterval(map[string]time.Duration{"fast": time.Millisecond}))
+	m.updatert = time.Hour
+	go m.sender()
+
+	m.updateGroup(poolKey{setName: "fast", provider: "static/0"}, []*targetgroup.Group{{Source: "s1"}})
+	m.markPending([]string{"fast"})
+
+	select {
+	case delta := <-m.syncCh:
+		require.Contains(t, delta, "fast")
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the first send of fast")
+	}
+
+	// A setName's first send is never throttled; the second one waits for
+	// its interval, which is fast's 1ms rather than the hour-long default.
+	// The sleep lets sender record the first send before the next update.
+	time.Sleep(10 * time.Millisecond)
+	m.updateGroup(poolKey{setName: "fast", provider: "static/0"}, []*targetgroup.Group{{Source: "s2"}})
+	m.markPending([]string{"fast"})
+
+	select {
+	case delta := <-m.syncCh:
+		require.Contains(t, delta, "fast")
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for fast setName to be sent despite the long default interval")
+	}
+}
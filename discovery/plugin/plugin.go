@@ -0,0 +1,206 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugin implements service discovery for out-of-process plugins,
+// modeled after virtual-kubelet's pluggable provider design: third parties
+// ship a small binary speaking the protocol in pluginpb instead of patching
+// Prometheus to add a new discovery mechanism.
+package plugin
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/prometheus/prometheus/discovery"
+	"github.com/prometheus/prometheus/discovery/plugin/pluginpb"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+)
+
+func init() {
+	discovery.RegisterConfig(&PluginConfig{})
+}
+
+// minBackoff and maxBackoff bound the exponential backoff applied between
+// reconnect attempts to a plugin that keeps dying.
+const (
+	minBackoff = 1 * time.Second
+	maxBackoff = 1 * time.Minute
+
+	healthCheckInterval = 15 * time.Second
+)
+
+// PluginConfig configures an out-of-process discovery plugin reached over
+// gRPC, e.g.:
+//
+//	plugin_sd_configs:
+//	  - name: myco
+//	    address: unix:///var/run/psd.sock
+type PluginConfig struct {
+	// Name identifies the plugin for logging and metrics; it has no
+	// relation to the process' own idea of its name.
+	PluginName string `yaml:"name"`
+	// Address is any address accepted by grpc.Dial, e.g. "unix:///run/psd.sock"
+	// or "psd.internal:10000".
+	Address string `yaml:"address"`
+}
+
+// Name returns the name of the discovery mechanism.
+func (*PluginConfig) Name() string { return "plugin" }
+
+// NewDiscoverer returns a Discoverer for the Config.
+func (c *PluginConfig) NewDiscoverer(opts discovery.DiscovererOptions) (discovery.Discoverer, error) {
+	l := opts.Logger
+	if l == nil {
+		l = log.NewNopLogger()
+	}
+	return &Discoverer{config: c, logger: l}, nil
+}
+
+// Discoverer maintains a gRPC connection to a single discovery plugin and
+// forwards the target groups it streams back to the manager's update
+// channel.
+type Discoverer struct {
+	config *PluginConfig
+	logger log.Logger
+}
+
+// Run implements the discovery.Discoverer interface. It dials the plugin and
+// reconnects with exponential backoff for as long as the context is alive,
+// skipping reconnect attempts while the plugin reports itself unhealthy.
+func (d *Discoverer) Run(ctx context.Context, up chan<- []*targetgroup.Group) {
+	backoff := minBackoff
+	for {
+		streamed, err := d.runOnce(ctx, up)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			level.Error(d.logger).Log("msg", "plugin discoverer connection failed, retrying", "name", d.config.PluginName, "err", err, "backoff", backoff)
+		}
+
+		// A connection that made it far enough to stream at least one
+		// update was healthy; don't let a clean reconnect after hours of
+		// uptime pay the backoff a string of earlier flaps built up.
+		if streamed {
+			backoff = minBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// runOnce dials the plugin once and streams updates from it until the
+// connection drops or the context is canceled. A nil error with a canceled
+// context means a clean shutdown. The returned bool reports whether at
+// least one update was successfully streamed before the connection ended,
+// so Run can tell a flaky dial from a healthy connection that just closed.
+func (d *Discoverer) runOnce(ctx context.Context, up chan<- []*targetgroup.Group) (bool, error) {
+	conn, err := grpc.DialContext(ctx, d.config.Address, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	client := pluginpb.NewDiscoveryPluginClient(conn)
+	if !d.waitHealthy(ctx, client) {
+		return false, ctx.Err()
+	}
+
+	stream, err := client.Discover(ctx)
+	if err != nil {
+		return false, err
+	}
+	if err := stream.Send(&pluginpb.DiscoverRequest{Resync: true}); err != nil {
+		return false, err
+	}
+
+	streamed := false
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return streamed, nil
+		}
+		if err != nil {
+			return streamed, err
+		}
+
+		groups := make([]*targetgroup.Group, 0, len(resp.Groups))
+		for _, g := range resp.Groups {
+			groups = append(groups, toTargetGroup(g))
+		}
+
+		select {
+		case up <- groups:
+			streamed = true
+		case <-ctx.Done():
+			return streamed, nil
+		}
+	}
+}
+
+// waitHealthy blocks until the plugin's Health RPC reports ready or the
+// context is canceled, polling every healthCheckInterval. A failed Health
+// call, including one on a lost connection, is logged and polled again. It
+// returns false only when the context is canceled.
+func (d *Discoverer) waitHealthy(ctx context.Context, client pluginpb.DiscoveryPluginClient) bool {
+	for {
+		resp, err := client.Health(ctx, &pluginpb.HealthRequest{})
+		if err == nil && resp.GetReady() {
+			return true
+		}
+		if err != nil {
+			level.Debug(d.logger).Log("msg", "plugin health check failed", "name", d.config.PluginName, "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(healthCheckInterval):
+		}
+	}
+}
+
+func toTargetGroup(g *pluginpb.TargetGroup) *targetgroup.Group {
+	tg := &targetgroup.Group{Source: g.GetSource()}
+
+	if len(g.GetLabels()) > 0 {
+		tg.Labels = make(model.LabelSet, len(g.GetLabels()))
+		for k, v := range g.GetLabels() {
+			tg.Labels[model.LabelName(k)] = model.LabelValue(v)
+		}
+	}
+
+	for _, t := range g.GetTargets() {
+		tg.Targets = append(tg.Targets, model.LabelSet{
+			model.AddressLabel: model.LabelValue(t),
+		})
+	}
+
+	return tg
+}
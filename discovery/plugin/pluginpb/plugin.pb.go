@@ -0,0 +1,107 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pluginpb holds the wire types for the discovery plugin protocol
+// defined in plugin.proto. Regenerate with `make proto` after editing the
+// .proto file; this file is checked in so that `go build` doesn't require a
+// protoc toolchain.
+package pluginpb
+
+import "google.golang.org/protobuf/proto"
+
+// DiscoverRequest asks the plugin for an update; Resync requests a full
+// resend of the current target set instead of an incremental one.
+type DiscoverRequest struct {
+	Resync bool `protobuf:"varint,1,opt,name=resync,proto3" json:"resync,omitempty"`
+}
+
+func (x *DiscoverRequest) Reset()         { *x = DiscoverRequest{} }
+func (x *DiscoverRequest) String() string { return proto.MessageName(x) }
+func (*DiscoverRequest) ProtoMessage()    {}
+
+func (x *DiscoverRequest) GetResync() bool {
+	if x != nil {
+		return x.Resync
+	}
+	return false
+}
+
+// DiscoverResponse carries the plugin's current view of its target groups.
+type DiscoverResponse struct {
+	Groups []*TargetGroup `protobuf:"bytes,1,rep,name=groups,proto3" json:"groups,omitempty"`
+}
+
+func (x *DiscoverResponse) Reset()         { *x = DiscoverResponse{} }
+func (x *DiscoverResponse) String() string { return proto.MessageName(x) }
+func (*DiscoverResponse) ProtoMessage()    {}
+
+func (x *DiscoverResponse) GetGroups() []*TargetGroup {
+	if x != nil {
+		return x.Groups
+	}
+	return nil
+}
+
+// TargetGroup mirrors discovery/targetgroup.Group on the wire.
+type TargetGroup struct {
+	Source  string            `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	Labels  map[string]string `protobuf:"bytes,2,rep,name=labels,proto3" json:"labels,omitempty"`
+	Targets []string          `protobuf:"bytes,3,rep,name=targets,proto3" json:"targets,omitempty"`
+}
+
+func (x *TargetGroup) Reset()         { *x = TargetGroup{} }
+func (x *TargetGroup) String() string { return proto.MessageName(x) }
+func (*TargetGroup) ProtoMessage()    {}
+
+func (x *TargetGroup) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *TargetGroup) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *TargetGroup) GetTargets() []string {
+	if x != nil {
+		return x.Targets
+	}
+	return nil
+}
+
+// HealthRequest is empty; Health is a liveness/readiness poll.
+type HealthRequest struct{}
+
+func (x *HealthRequest) Reset()         { *x = HealthRequest{} }
+func (x *HealthRequest) String() string { return proto.MessageName(x) }
+func (*HealthRequest) ProtoMessage()    {}
+
+type HealthResponse struct {
+	Ready bool `protobuf:"varint,1,opt,name=ready,proto3" json:"ready,omitempty"`
+}
+
+func (x *HealthResponse) Reset()         { *x = HealthResponse{} }
+func (x *HealthResponse) String() string { return proto.MessageName(x) }
+func (*HealthResponse) ProtoMessage()    {}
+
+func (x *HealthResponse) GetReady() bool {
+	if x != nil {
+		return x.Ready
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pluginpb
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	serviceName      = "prometheus.discovery.plugin.DiscoveryPlugin"
+	discoverFullName = "/" + serviceName + "/Discover"
+	healthFullName   = "/" + serviceName + "/Health"
+)
+
+// DiscoveryPluginClient is the client API for DiscoveryPlugin.
+type DiscoveryPluginClient interface {
+	Discover(ctx context.Context, opts ...grpc.CallOption) (DiscoveryPlugin_DiscoverClient, error)
+	Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error)
+}
+
+type discoveryPluginClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewDiscoveryPluginClient wraps a dialed connection as a DiscoveryPluginClient.
+func NewDiscoveryPluginClient(cc grpc.ClientConnInterface) DiscoveryPluginClient {
+	return &discoveryPluginClient{cc}
+}
+
+func (c *discoveryPluginClient) Discover(ctx context.Context, opts ...grpc.CallOption) (DiscoveryPlugin_DiscoverClient, error) {
+	stream, err := c.cc.NewStream(ctx, &discoveryPluginServiceDesc.Streams[0], discoverFullName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &discoveryPluginDiscoverClient{stream}, nil
+}
+
+func (c *discoveryPluginClient) Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error) {
+	out := new(HealthResponse)
+	if err := c.cc.Invoke(ctx, healthFullName, in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DiscoveryPlugin_DiscoverClient is the streaming handle returned by Discover.
+type DiscoveryPlugin_DiscoverClient interface {
+	Send(*DiscoverRequest) error
+	Recv() (*DiscoverResponse, error)
+	grpc.ClientStream
+}
+
+type discoveryPluginDiscoverClient struct {
+	grpc.ClientStream
+}
+
+func (x *discoveryPluginDiscoverClient) Send(m *DiscoverRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *discoveryPluginDiscoverClient) Recv() (*DiscoverResponse, error) {
+	m := new(DiscoverResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DiscoveryPluginServer is the server API for DiscoveryPlugin.
+type DiscoveryPluginServer interface {
+	Discover(DiscoveryPlugin_DiscoverServer) error
+	Health(context.Context, *HealthRequest) (*HealthResponse, error)
+}
+
+// DiscoveryPlugin_DiscoverServer is the streaming handle passed to a server implementation.
+type DiscoveryPlugin_DiscoverServer interface {
+	Send(*DiscoverResponse) error
+	Recv() (*DiscoverRequest, error)
+	grpc.ServerStream
+}
+
+type discoveryPluginDiscoverServer struct {
+	grpc.ServerStream
+}
+
+func (x *discoveryPluginDiscoverServer) Send(m *DiscoverResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *discoveryPluginDiscoverServer) Recv() (*DiscoverRequest, error) {
+	m := new(DiscoverRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func discoverHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DiscoveryPluginServer).Discover(&discoveryPluginDiscoverServer{stream})
+}
+
+func healthHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DiscoveryPluginServer).Health(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: healthFullName}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DiscoveryPluginServer).Health(ctx, req.(*HealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// RegisterDiscoveryPluginServer registers srv on s.
+func RegisterDiscoveryPluginServer(s grpc.ServiceRegistrar, srv DiscoveryPluginServer) {
+	s.RegisterService(&discoveryPluginServiceDesc, srv)
+}
+
+var discoveryPluginServiceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*DiscoveryPluginServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Health",
+			Handler:    healthHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Discover",
+			Handler:       discoverHandler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "discovery/plugin/pluginpb/plugin.proto",
+}
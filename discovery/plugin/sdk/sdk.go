@@ -0,0 +1,137 @@
+// Copyright 2026 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sdk lets a third party expose a discovery.Discoverer as a
+// standalone plugin process that Prometheus can consume through
+// plugin_sd_configs, without depending on the rest of Prometheus.
+package sdk
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/prometheus/common/model"
+	"google.golang.org/grpc"
+
+	"github.com/prometheus/prometheus/discovery"
+	"github.com/prometheus/prometheus/discovery/plugin/pluginpb"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+)
+
+// Serve registers d on a new gRPC server and blocks, accepting connections
+// on lis, until ctx is canceled. The server reports itself healthy as soon
+// as d.Run's update channel has delivered at least one group set.
+//
+// Typical usage:
+//
+//	lis, err := net.Listen("unix", "/var/run/psd.sock")
+//	...
+//	sdk.Serve(ctx, lis, myDiscoverer)
+func Serve(ctx context.Context, lis net.Listener, d discovery.Discoverer) error {
+	srv := grpc.NewServer()
+	pluginpb.RegisterDiscoveryPluginServer(srv, newServer(ctx, d))
+
+	go func() {
+		<-ctx.Done()
+		srv.GracefulStop()
+	}()
+
+	return srv.Serve(lis)
+}
+
+type server struct {
+	pluginpb.DiscoveryPluginServer
+
+	updates   chan []*targetgroup.Group
+	ready     chan struct{}
+	readyOnce sync.Once
+}
+
+func newServer(ctx context.Context, d discovery.Discoverer) *server {
+	s := &server{
+		updates: make(chan []*targetgroup.Group),
+		ready:   make(chan struct{}),
+	}
+	produced := make(chan []*targetgroup.Group)
+	go d.Run(ctx, produced)
+	// Mark ready as soon as Run produces a group set, without waiting for a
+	// Discover stream to read it: clients only open Discover once healthy.
+	go func() {
+		defer close(s.updates)
+		for groups := range produced {
+			s.markReady()
+			select {
+			case s.updates <- groups:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// markReady closes s.ready exactly once, safe to call concurrently from the
+// multiple Discover streams a reconnecting client can have in flight at once.
+func (s *server) markReady() {
+	s.readyOnce.Do(func() { close(s.ready) })
+}
+
+// Health reports ready once the wrapped Discoverer has produced its first
+// set of target groups.
+func (s *server) Health(ctx context.Context, _ *pluginpb.HealthRequest) (*pluginpb.HealthResponse, error) {
+	select {
+	case <-s.ready:
+		return &pluginpb.HealthResponse{Ready: true}, nil
+	default:
+		return &pluginpb.HealthResponse{Ready: false}, nil
+	}
+}
+
+// Discover relays groups produced by the wrapped Discoverer to the stream
+// until the stream's context is done.
+func (s *server) Discover(stream pluginpb.DiscoveryPlugin_DiscoverServer) error {
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case groups, ok := <-s.updates:
+			if !ok {
+				return nil
+			}
+			s.markReady()
+			if err := stream.Send(&pluginpb.DiscoverResponse{Groups: toWireGroups(groups)}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func toWireGroups(groups []*targetgroup.Group) []*pluginpb.TargetGroup {
+	out := make([]*pluginpb.TargetGroup, 0, len(groups))
+	for _, g := range groups {
+		wg := &pluginpb.TargetGroup{Source: g.Source}
+		if len(g.Labels) > 0 {
+			wg.Labels = make(map[string]string, len(g.Labels))
+			for k, v := range g.Labels {
+				wg.Labels[string(k)] = string(v)
+			}
+		}
+		for _, t := range g.Targets {
+			wg.Targets = append(wg.Targets, string(t[model.AddressLabel]))
+		}
+		out = append(out, wg)
+	}
+	return out
+}